@@ -0,0 +1,65 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// +genclient
+// +genclient:noStatus
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen=true
+
+// CiliumClusterwideNetworkPolicy is a Kubernetes third-party resource with an
+// modified version of NetworkPolicy which abstracts away the Kubernetes
+// security identity relevant details and enables it to be used as a
+// cluster-scoped policy, intended to apply to endpoints regardless of which
+// namespace they live in, including endpoints that are not tied to any
+// namespace at all (e.g. host endpoints). The CRD registration
+// (createCCNPCRD) only makes the cluster-scoped object representable in the
+// k8s API; translating it into rules that are actually evaluated across
+// namespaces is the policy repository's job and is not implemented in this
+// source tree.
+type CiliumClusterwideNetworkPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the desired Cilium specific rule specification.
+	Spec *api.Rule `json:"spec,omitempty"`
+
+	// Specs is a list of desired Cilium specific rule specification.
+	Specs api.Rules `json:"specs,omitempty"`
+
+	// Status is the status of the Cilium policy rule.
+	//
+	// +kubebuilder:validation:Optional
+	Status CiliumNetworkPolicyStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// CiliumClusterwideNetworkPolicyList is a list of
+// CiliumClusterwideNetworkPolicy objects.
+type CiliumClusterwideNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	// Items is a list of CiliumClusterwideNetworkPolicy.
+	Items []CiliumClusterwideNetworkPolicy `json:"items"`
+}
@@ -0,0 +1,22 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+// Hub marks CiliumNetworkPolicy as the conversion hub: the version that
+// other versions (currently only v2alpha1) convert to and from, and the one
+// that is actually persisted. Spoke versions implement ConvertTo(*v2.CiliumNetworkPolicy)
+// and ConvertFrom(*v2.CiliumNetworkPolicy); the webhook in this package
+// drives that conversion via the apiserver's ConversionReview callback.
+func (*CiliumNetworkPolicy) Hub() {}
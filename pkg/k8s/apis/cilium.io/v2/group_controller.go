@@ -0,0 +1,115 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// maxGroupDepth bounds how many levels of ChildGroups composition the group
+// controller will follow before giving up. This protects against
+// pathologically deep (if acyclic) group graphs turning a single group
+// update into an unbounded amount of translation work.
+const maxGroupDepth = 10
+
+// GroupLookup returns the group with the given name, preferring a
+// cluster-scoped CiliumClusterwideGroup and falling back to a CiliumGroup in
+// namespace. The caller of NewGroupResolver supplies the implementation;
+// tests use a map-based fake.
+type GroupLookup interface {
+	LookupGroup(namespace, name string) (GroupSpec, bool)
+}
+
+// GroupResolver resolves a group name (as would be carried by a
+// FromGroups/ToGroups reference, see api.GroupReferences) into the set of
+// EndpointSelectors the named group stands for: its own PodSelector,
+// NamespaceSelector and ExternalEntitySelector, plus everything its
+// ChildGroups resolve to, recursively.
+//
+// This is a standalone building block, not a wired-up feature: nothing in
+// this source tree watches CiliumGroup/CiliumClusterwideGroup objects and
+// calls Resolve when they change, and api.IngressRule/api.EgressRule (which
+// would need the actual FromGroups/ToGroups fields) aren't defined in this
+// tree either - only pkg/policy/api/rule.go is present here, not the files
+// that would define those two types or the policy repository that
+// translates Rule into something enforced. Wiring Resolve into rule
+// translation belongs in whichever package owns that translation, once it
+// exists in this tree.
+type GroupResolver struct {
+	lookup GroupLookup
+}
+
+// NewGroupResolver creates a GroupResolver backed by the given lookup.
+func NewGroupResolver(lookup GroupLookup) *GroupResolver {
+	return &GroupResolver{lookup: lookup}
+}
+
+// Resolve returns the EndpointSelectors that the group "name" (looked up
+// relative to namespace) expands to. It returns an error if the group does
+// not exist, or if following ChildGroups finds a cycle or exceeds
+// maxGroupDepth.
+func (r *GroupResolver) Resolve(namespace, name string) ([]api.EndpointSelector, error) {
+	return r.resolve(namespace, name, map[string]bool{}, 0)
+}
+
+func (r *GroupResolver) resolve(namespace, name string, visited map[string]bool, depth int) ([]api.EndpointSelector, error) {
+	key := namespace + "/" + name
+	if visited[key] {
+		return nil, fmt.Errorf("cycle detected resolving group %q", key)
+	}
+	if depth > maxGroupDepth {
+		return nil, fmt.Errorf("group %q exceeds max composition depth %d", key, maxGroupDepth)
+	}
+	visited[key] = true
+	// Un-mark key once this branch is done, so it only tracks ancestors on
+	// the current path, not every group seen anywhere in the call tree.
+	// Without this, a diamond-shaped (non-cyclic) graph - e.g. two siblings
+	// that both list the same ChildGroups entry - would falsely look like a
+	// cycle the second time that shared child is reached.
+	defer delete(visited, key)
+
+	group, ok := r.lookup.LookupGroup(namespace, name)
+	if !ok {
+		return nil, fmt.Errorf("group %q not found", key)
+	}
+
+	selectors := ownSelectors(group)
+	for _, childName := range group.ChildGroups {
+		childSelectors, err := r.resolve(namespace, childName, visited, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("resolving child group %q of %q: %w", childName, key, err)
+		}
+		selectors = append(selectors, childSelectors...)
+	}
+
+	return selectors, nil
+}
+
+// ownSelectors returns the EndpointSelectors this group contributes itself,
+// not counting any ChildGroups.
+func ownSelectors(group GroupSpec) []api.EndpointSelector {
+	var selectors []api.EndpointSelector
+	for _, ls := range []*metav1.LabelSelector{group.PodSelector, group.NamespaceSelector, group.ExternalEntitySelector} {
+		if ls == nil {
+			continue
+		}
+		selectors = append(selectors, api.NewESFromK8sLabelSelector("", ls))
+	}
+	return selectors
+}
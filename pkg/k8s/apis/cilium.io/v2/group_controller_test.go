@@ -0,0 +1,96 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "gopkg.in/check.v1"
+)
+
+type GroupControllerSuite struct{}
+
+var _ = Suite(&GroupControllerSuite{})
+
+type fakeGroupLookup map[string]GroupSpec
+
+func (f fakeGroupLookup) LookupGroup(namespace, name string) (GroupSpec, bool) {
+	g, ok := f[namespace+"/"+name]
+	return g, ok
+}
+
+func (s *GroupControllerSuite) TestResolveUnionsChildGroups(c *C) {
+	lookup := fakeGroupLookup{
+		"ns/parent": {
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "parent"}},
+			ChildGroups: []string{"child"},
+		},
+		"ns/child": {
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "child"}},
+		},
+	}
+	resolver := NewGroupResolver(lookup)
+
+	selectors, err := resolver.Resolve("ns", "parent")
+	c.Assert(err, IsNil)
+	c.Assert(selectors, HasLen, 2)
+}
+
+func (s *GroupControllerSuite) TestResolveAllowsDiamondComposition(c *C) {
+	lookup := fakeGroupLookup{
+		"ns/parent": {ChildGroups: []string{"childA", "childB"}},
+		"ns/childA": {ChildGroups: []string{"common"}},
+		"ns/childB": {ChildGroups: []string{"common"}},
+		"ns/common": {PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "common"}}},
+	}
+	resolver := NewGroupResolver(lookup)
+
+	// childA and childB both list "common"; that's ordinary diamond-shaped
+	// composition, not a cycle, even though "common" is reached twice.
+	selectors, err := resolver.Resolve("ns", "parent")
+	c.Assert(err, IsNil)
+	c.Assert(selectors, HasLen, 2)
+}
+
+func (s *GroupControllerSuite) TestResolveDetectsCycle(c *C) {
+	lookup := fakeGroupLookup{
+		"ns/a": {ChildGroups: []string{"b"}},
+		"ns/b": {ChildGroups: []string{"a"}},
+	}
+	resolver := NewGroupResolver(lookup)
+
+	_, err := resolver.Resolve("ns", "a")
+	c.Assert(err, ErrorMatches, ".*cycle detected.*")
+}
+
+func (s *GroupControllerSuite) TestResolveMissingGroup(c *C) {
+	resolver := NewGroupResolver(fakeGroupLookup{})
+
+	_, err := resolver.Resolve("ns", "missing")
+	c.Assert(err, ErrorMatches, ".*not found.*")
+}
+
+func (s *GroupControllerSuite) TestResolveBoundsDepth(c *C) {
+	lookup := fakeGroupLookup{}
+	for i := 0; i < maxGroupDepth+5; i++ {
+		name := "g" + string(rune('a'+i))
+		next := "g" + string(rune('a'+i+1))
+		lookup["ns/"+name] = GroupSpec{ChildGroups: []string{next}}
+	}
+	resolver := NewGroupResolver(lookup)
+
+	_, err := resolver.Resolve("ns", "ga")
+	c.Assert(err, ErrorMatches, ".*exceeds max composition depth.*")
+}
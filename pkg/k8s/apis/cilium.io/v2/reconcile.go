@@ -0,0 +1,187 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// crdEstablishTimeout bounds the whole wait for a CRD to become Established,
+// across all backoff steps combined.
+const crdEstablishTimeout = 60 * time.Second
+
+// crdEstablishBackoff grows the poll interval geometrically instead of
+// hammering the apiserver every 500ms for up to a minute; a healthy
+// apiserver usually establishes a CRD within the first step or two, and an
+// unhealthy one doesn't need ten times as many requests to tell us that.
+func crdEstablishBackoff() []time.Duration {
+	delays := make([]time.Duration, 0, 8)
+	d := 200 * time.Millisecond
+	for total := time.Duration(0); total < crdEstablishTimeout; {
+		delays = append(delays, d)
+		total += d
+		d *= 2
+		if d > 10*time.Second {
+			d = 10 * time.Second
+		}
+	}
+	return delays
+}
+
+// waitForEstablished polls getConditions until it reports Established, a
+// definitive NamesAccepted=False, or ctx is done. It never deletes the CRD
+// on failure or timeout: unlike the fixed-delay poll this replaces, giving
+// up here just means the caller's next reconcile pass (next agent restart,
+// or the next Lease holder) gets to try again against whatever is already
+// in the cluster, instead of destroying a CRD - and the CRs stored under
+// it - because one apiserver round trip was slow.
+func waitForEstablished(ctx context.Context, crdName string, getConditions func() ([]apiextensionsv1.CustomResourceDefinitionCondition, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishTimeout)
+	defer cancel()
+
+	for _, delay := range crdEstablishBackoff() {
+		conds, err := getConditions()
+		if err == nil {
+			for _, cond := range conds {
+				switch cond.Type {
+				case apiextensionsv1.Established:
+					if cond.Status == apiextensionsv1.ConditionTrue {
+						return nil
+					}
+				case apiextensionsv1.NamesAccepted:
+					if cond.Status == apiextensionsv1.ConditionFalse {
+						return fmt.Errorf("name conflict for CRD %s: %s", crdName, cond.Reason)
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for CRD %s to become established: %w", crdName, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return fmt.Errorf("timed out waiting for CRD %s to become established", crdName)
+}
+
+// waitForEstablishedV1beta1 is waitForEstablished for the legacy
+// apiextensions.k8s.io/v1beta1 condition type, used on pre-1.16 apiservers.
+func waitForEstablishedV1beta1(ctx context.Context, crdName string, getConditions func() ([]apiextensionsv1beta1.CustomResourceDefinitionCondition, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishTimeout)
+	defer cancel()
+
+	for _, delay := range crdEstablishBackoff() {
+		conds, err := getConditions()
+		if err == nil {
+			for _, cond := range conds {
+				switch cond.Type {
+				case apiextensionsv1beta1.Established:
+					if cond.Status == apiextensionsv1beta1.ConditionTrue {
+						return nil
+					}
+				case apiextensionsv1beta1.NamesAccepted:
+					if cond.Status == apiextensionsv1beta1.ConditionFalse {
+						return fmt.Errorf("name conflict for CRD %s: %s", crdName, cond.Reason)
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for CRD %s to become established: %w", crdName, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return fmt.Errorf("timed out waiting for CRD %s to become established", crdName)
+}
+
+// mergeCRDSpec folds the schema/versions this binary manages onto whatever
+// is already installed in the cluster, instead of overwriting Spec
+// wholesale. Anything the cluster carries that desired doesn't know about -
+// printer columns a user appended, a Conversion stanza desired left unset,
+// or an entire extra served version - survives the update.
+func mergeCRDSpec(cluster, desired apiextensionsv1.CustomResourceDefinitionSpec) apiextensionsv1.CustomResourceDefinitionSpec {
+	merged := desired
+
+	if desired.Conversion == nil {
+		merged.Conversion = cluster.Conversion
+	}
+
+	clusterVersions := make(map[string]apiextensionsv1.CustomResourceDefinitionVersion, len(cluster.Versions))
+	for _, v := range cluster.Versions {
+		clusterVersions[v.Name] = v
+	}
+
+	seen := make(map[string]bool, len(desired.Versions))
+	mergedVersions := make([]apiextensionsv1.CustomResourceDefinitionVersion, 0, len(desired.Versions))
+	for _, dv := range desired.Versions {
+		seen[dv.Name] = true
+		if cv, ok := clusterVersions[dv.Name]; ok {
+			dv.AdditionalPrinterColumns = mergePrinterColumns(cv.AdditionalPrinterColumns, dv.AdditionalPrinterColumns)
+		}
+		mergedVersions = append(mergedVersions, dv)
+	}
+	// A version this binary doesn't manage (e.g. hand-added by an operator)
+	// is left alone rather than silently dropped.
+	for _, cv := range cluster.Versions {
+		if !seen[cv.Name] {
+			mergedVersions = append(mergedVersions, cv)
+		}
+	}
+	merged.Versions = mergedVersions
+
+	return merged
+}
+
+// mergePrinterColumns returns desired's columns plus any cluster column
+// whose Name desired doesn't already define.
+func mergePrinterColumns(cluster, desired []apiextensionsv1.CustomResourceColumnDefinition) []apiextensionsv1.CustomResourceColumnDefinition {
+	merged := append([]apiextensionsv1.CustomResourceColumnDefinition{}, desired...)
+	have := make(map[string]bool, len(desired))
+	for _, col := range desired {
+		have[col.Name] = true
+	}
+	for _, col := range cluster {
+		if !have[col.Name] {
+			merged = append(merged, col)
+		}
+	}
+	return merged
+}
+
+// crdSchemaDowngradeRefusedTotal counts how often this agent found a CRD
+// already labeled with a newer schema version than it knows how to write,
+// and left it alone rather than downgrading it. A non-zero rate usually
+// means a rollback is in progress, or agents at two different versions are
+// running against the same cluster.
+var crdSchemaDowngradeRefusedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "cilium",
+	Subsystem: "k8s",
+	Name:      "crd_schema_downgrade_refused_total",
+	Help:      "Number of times a CRD update was skipped because the cluster's schema version label was newer than this agent's",
+}, []string{"crd"})
+
+func init() {
+	prometheus.MustRegister(crdSchemaDowngradeRefusedTotal)
+}
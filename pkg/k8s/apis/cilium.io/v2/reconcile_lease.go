@@ -0,0 +1,152 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// crdReconcileLeaseName is the coordination.k8s.io/Lease used to elect a
+// single agent to create/update all CRDs in CreateCustomResourceDefinitions.
+// Without this, every agent in the cluster races to reconcile the same CRDs
+// on startup; they used to rely solely on IsAlreadyExists on Create, which
+// does nothing to stop two agents from stomping on each other's Update.
+const crdReconcileLeaseName = "cilium-crd-reconcile"
+
+// crdReconcileLeaseNamespace is where the coordination Lease lives. It does
+// not need to match any particular workload's namespace since CRDs
+// themselves are cluster-scoped.
+const crdReconcileLeaseNamespace = "kube-system"
+
+// crdReconcileLeaseDuration bounds how long a holder's claim is honored
+// without being renewed. It only needs to outlive one reconcile pass
+// (a handful of Get/Create/Update calls), not a full agent lifetime.
+const crdReconcileLeaseDuration = 30 * time.Second
+
+// leaseClient is configured once by the agent at startup via
+// SetCRDReconcileLeaseClient. When nil (the default, and always the case in
+// unit tests that don't call it), CreateCustomResourceDefinitions reconciles
+// without coordination, exactly as it did before this package learned about
+// leases.
+var leaseClient coordinationv1client.CoordinationV1Interface
+
+// SetCRDReconcileLeaseClient configures the client used to elect a single
+// agent to reconcile CRDs. Call it once during agent startup, before
+// CreateCustomResourceDefinitions.
+func SetCRDReconcileLeaseClient(c coordinationv1client.CoordinationV1Interface) {
+	leaseClient = c
+}
+
+func reconcileHolderIdentity() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+// acquireCRDReconcileLease attempts to become the holder of the CRD
+// reconcile lease. It returns acquired=true immediately (with a no-op
+// release) if no lease client has been configured, so that callers which
+// never opted into coordination behave exactly as before. The returned
+// release function should be deferred by the caller to give up the lease as
+// soon as reconciliation finishes, rather than holding it for the full TTL.
+func acquireCRDReconcileLease() (release func(), acquired bool, err error) {
+	if leaseClient == nil {
+		return func() {}, true, nil
+	}
+
+	identity := reconcileHolderIdentity()
+	leases := leaseClient.Leases(crdReconcileLeaseNamespace)
+
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(crdReconcileLeaseDuration.Seconds())
+
+	existing, err := leases.Get(crdReconcileLeaseName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: crdReconcileLeaseName},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		created, err := leases.Create(lease)
+		if errors.IsAlreadyExists(err) {
+			// Lost the race to create; fall through and treat it like any
+			// other pre-existing lease below.
+			existing, err = leases.Get(crdReconcileLeaseName, metav1.GetOptions{})
+			if err != nil {
+				return nil, false, err
+			}
+		} else if err != nil {
+			return nil, false, err
+		} else {
+			return releaseLeaseFunc(leases, created), true, nil
+		}
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if !leaseExpired(existing) && !leaseHeldBy(existing, identity) {
+		return nil, false, nil
+	}
+
+	existing.Spec.HolderIdentity = &identity
+	existing.Spec.LeaseDurationSeconds = &durationSeconds
+	existing.Spec.AcquireTime = &now
+	existing.Spec.RenewTime = &now
+	updated, err := leases.Update(existing)
+	if errors.IsConflict(err) {
+		// Someone else took it between our Get and Update.
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return releaseLeaseFunc(leases, updated), true, nil
+}
+
+func releaseLeaseFunc(leases coordinationv1client.LeaseInterface, lease *coordinationv1.Lease) func() {
+	return func() {
+		// Back the RenewTime off into the past so the next agent to start
+		// doesn't have to wait out the full lease duration.
+		expired := metav1.NewMicroTime(time.Now().Add(-crdReconcileLeaseDuration))
+		lease.Spec.RenewTime = &expired
+		if _, err := leases.Update(lease); err != nil {
+			log.WithError(err).WithField("lease", crdReconcileLeaseName).Debug("Unable to release CRD reconcile lease early; it will expire on its own")
+		}
+	}
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	deadline := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(deadline)
+}
+
+func leaseHeldBy(lease *coordinationv1.Lease, identity string) bool {
+	return lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == identity
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	. "gopkg.in/check.v1"
+)
+
+type LeaseSuite struct{}
+
+var _ = Suite(&LeaseSuite{})
+
+func (s *LeaseSuite) SetUpTest(c *C) {
+	leaseClient = nil
+}
+
+func (s *LeaseSuite) TearDownTest(c *C) {
+	leaseClient = nil
+}
+
+func (s *LeaseSuite) TestAcquireCRDReconcileLeaseNoClientIsNoop(c *C) {
+	release, acquired, err := acquireCRDReconcileLease()
+	c.Assert(err, IsNil)
+	c.Assert(acquired, Equals, true)
+	release()
+}
+
+func (s *LeaseSuite) TestAcquireCRDReconcileLeaseSecondAgentLosesRace(c *C) {
+	clientset := k8sfake.NewSimpleClientset()
+	SetCRDReconcileLeaseClient(clientset.CoordinationV1())
+	defer SetCRDReconcileLeaseClient(nil)
+
+	release, acquired, err := acquireCRDReconcileLease()
+	c.Assert(err, IsNil)
+	c.Assert(acquired, Equals, true)
+
+	// A second agent trying to reconcile at the same time must not also
+	// acquire the lease while the first agent still holds it. Agents are
+	// told apart by hostname, which every call in this process shares, so
+	// the stored lease is relabeled as held by another agent first.
+	leases := clientset.CoordinationV1().Leases(crdReconcileLeaseNamespace)
+	held, err := leases.Get(crdReconcileLeaseName, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	otherHolder := "some-other-agent"
+	held.Spec.HolderIdentity = &otherHolder
+	_, err = leases.Update(held)
+	c.Assert(err, IsNil)
+
+	_, acquired, err = acquireCRDReconcileLease()
+	c.Assert(err, IsNil)
+	c.Assert(acquired, Equals, false)
+
+	release()
+
+	// Once released, the lease is available again (e.g. to a retry from the
+	// same agent, or another one).
+	release2, acquired, err := acquireCRDReconcileLease()
+	c.Assert(err, IsNil)
+	c.Assert(acquired, Equals, true)
+	release2()
+}
+
+func (s *LeaseSuite) TestAcquireCRDReconcileLeaseReclaimsExpiredLease(c *C) {
+	clientset := k8sfake.NewSimpleClientset()
+	SetCRDReconcileLeaseClient(clientset.CoordinationV1())
+	defer SetCRDReconcileLeaseClient(nil)
+
+	leases := clientset.CoordinationV1().Leases(crdReconcileLeaseNamespace)
+	expiredRenew := metav1.NewMicroTime(time.Now().Add(-2 * crdReconcileLeaseDuration))
+	durationSeconds := int32(crdReconcileLeaseDuration.Seconds())
+	otherHolder := "some-other-agent"
+	_, err := leases.Create(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: crdReconcileLeaseName},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &otherHolder,
+			LeaseDurationSeconds: &durationSeconds,
+			RenewTime:            &expiredRenew,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	_, acquired, err := acquireCRDReconcileLease()
+	c.Assert(err, IsNil)
+	c.Assert(acquired, Equals, true)
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReconcileSuite struct{}
+
+var _ = Suite(&ReconcileSuite{})
+
+func (s *ReconcileSuite) TestMergeCRDSpecPreservesUnmanagedPrinterColumn(c *C) {
+	cluster := apiextensionsv1.CustomResourceDefinitionSpec{
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{
+				Name: "v2",
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+					{Name: "user-added", Type: "string", JSONPath: ".spec.userAdded"},
+				},
+			},
+		},
+	}
+	desired := apiextensionsv1.CustomResourceDefinitionSpec{
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{
+				Name: "v2",
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+					{Name: "age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+				},
+			},
+		},
+	}
+
+	merged := mergeCRDSpec(cluster, desired)
+	c.Assert(merged.Versions, HasLen, 1)
+	c.Assert(merged.Versions[0].AdditionalPrinterColumns, HasLen, 2)
+	c.Assert(merged.Versions[0].AdditionalPrinterColumns[0].Name, Equals, "age")
+	c.Assert(merged.Versions[0].AdditionalPrinterColumns[1].Name, Equals, "user-added")
+}
+
+func (s *ReconcileSuite) TestMergeCRDSpecPreservesUnmanagedConversion(c *C) {
+	cluster := apiextensionsv1.CustomResourceDefinitionSpec{
+		Conversion: &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.WebhookConverter},
+	}
+	desired := apiextensionsv1.CustomResourceDefinitionSpec{}
+
+	merged := mergeCRDSpec(cluster, desired)
+	c.Assert(merged.Conversion, Not(IsNil))
+	c.Assert(merged.Conversion.Strategy, Equals, apiextensionsv1.WebhookConverter)
+}
+
+func (s *ReconcileSuite) TestMergeCRDSpecPreservesUnmanagedVersion(c *C) {
+	cluster := apiextensionsv1.CustomResourceDefinitionSpec{
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{Name: "v2"},
+			{Name: "v3alpha1"}, // hand-added by an operator; this binary doesn't know about it
+		},
+	}
+	desired := apiextensionsv1.CustomResourceDefinitionSpec{
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{Name: "v2"},
+		},
+	}
+
+	merged := mergeCRDSpec(cluster, desired)
+	c.Assert(merged.Versions, HasLen, 2)
+	c.Assert(merged.Versions[1].Name, Equals, "v3alpha1")
+}
+
+func (s *ReconcileSuite) TestNeedsUpdateV1RefusesDowngrade(c *C) {
+	clusterCRD := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ciliumnetworkpolicies." + SchemeGroupVersion.Group,
+			Labels: map[string]string{CustomResourceDefinitionSchemaVersionKey: "99.0.0"},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v2", Schema: &apiextensionsv1.CustomResourceValidation{}},
+			},
+		},
+	}
+	desiredCRD := clusterCRD.DeepCopy()
+
+	before := testutil.ToFloat64(crdSchemaDowngradeRefusedTotal.WithLabelValues(clusterCRD.Name))
+	c.Assert(needsUpdateV1(clusterCRD, desiredCRD), Equals, false)
+	after := testutil.ToFloat64(crdSchemaDowngradeRefusedTotal.WithLabelValues(clusterCRD.Name))
+	c.Assert(after, Equals, before+1)
+}
@@ -15,15 +15,14 @@
 package v2
 
 import (
-	goerrors "errors"
-	"fmt"
+	"bytes"
+	"context"
 	"time"
 
-	"sigs.k8s.io/yaml"
-
 	k8sconst "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
 	"github.com/cilium/cilium/pkg/option"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -44,7 +43,7 @@ const (
 
 	// CustomResourceDefinitionSchemaVersion is semver-conformant version of CRD schema
 	// Used to determine if CRD needs to be updated in cluster
-	CustomResourceDefinitionSchemaVersion = "1.15"
+	CustomResourceDefinitionSchemaVersion = "1.16"
 
 	// CustomResourceDefinitionSchemaVersionKey is key to label which holds the CRD schema version
 	CustomResourceDefinitionSchemaVersionKey = "io.cilium.k8s.crd.schema.version"
@@ -55,6 +54,10 @@ const (
 	fqdnNameRegex = `^(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]*[a-zA-Z0-9])\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\-]*[A-Za-z0-9])\.?$`
 
 	fqdnPatternRegex = `^(([a-zA-Z0-9\*]|[a-zA-Z0-9\*][a-zA-Z0-9\-\*]*[a-zA-Z0-9\*])\.)*([A-Za-z0-9\*]|[A-Za-z0-9\*][A-Za-z0-9\-\*]*[A-Za-z0-9\*])\.?$`
+
+	// apiextensionsV1GroupVersion is the group/version string used to probe
+	// apiserver discovery for CRD v1 support.
+	apiextensionsV1GroupVersion = "apiextensions.k8s.io/v1"
 )
 
 // SchemeGroupVersion is group version used to register these objects
@@ -111,6 +114,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&CiliumNodeList{},
 		&CiliumIdentity{},
 		&CiliumIdentityList{},
+		&CiliumClusterwideNetworkPolicy{},
+		&CiliumClusterwideNetworkPolicyList{},
+		&CiliumGroup{},
+		&CiliumGroupList{},
+		&CiliumClusterwideGroup{},
+		&CiliumClusterwideGroupList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
@@ -118,9 +127,33 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 }
 
 // CreateCustomResourceDefinitions creates our CRD objects in the kubernetes
-// cluster
-func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) error {
-	if err := createCNPCRD(clientset); err != nil {
+// cluster. webhookCABundle is the CA certificate clients should trust when
+// calling the CNP conversion webhook; pass nil when cert-manager (or
+// another CA injector) annotates the CRD instead.
+func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface, webhookCABundle []byte) error {
+	release, acquired, err := acquireCRDReconcileLease()
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		log.Info("Another agent is already reconciling CRDs (CustomResourceDefinitions); skipping")
+		return nil
+	}
+	defer release()
+
+	if err := createCNPCRD(clientset, webhookCABundle); err != nil {
+		return err
+	}
+
+	if err := createCCNPCRD(clientset); err != nil {
+		return err
+	}
+
+	if err := createGroupCRD(clientset); err != nil {
+		return err
+	}
+
+	if err := createClusterwideGroupCRD(clientset); err != nil {
 		return err
 	}
 
@@ -141,38 +174,93 @@ func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) er
 	return nil
 }
 
-// createCNPCRD creates and updates the CiliumNetworkPolicies CRD. It should be called
-// on agent startup but is idempotent and safe to call again.
-func createCNPCRD(clientset apiextensionsclient.Interface) error {
-	var (
-		// CustomResourceDefinitionSingularName is the singular name of custom resource definition
-		CustomResourceDefinitionSingularName = "ciliumnetworkpolicy"
-
-		// CustomResourceDefinitionPluralName is the plural name of custom resource definition
-		CustomResourceDefinitionPluralName = "ciliumnetworkpolicies"
-
-		// CustomResourceDefinitionShortNames are the abbreviated names to refer to this CRD's instances
-		CustomResourceDefinitionShortNames = []string{"cnp", "ciliumnp"}
-
-		// CustomResourceDefinitionKind is the Kind name of custom resource definition
-		CustomResourceDefinitionKind = CNPKindDefinition
+// crdDefinition is the apiserver-version-neutral description of a CRD that
+// this package knows how to install. buildV1 and buildV1beta1 translate it
+// into the concrete apiextensions types for whichever apiserver flavor is
+// available.
+type crdDefinition struct {
+	// crdName is the fully qualified CRD object name, e.g. "ciliumnetworkpolicies.cilium.io"
+	crdName string
+
+	plural     string
+	singular   string
+	shortNames []string
+	kind       string
+	scope      string // "Namespaced" or "Cluster"
+
+	// schema is the structural OpenAPI v3 schema for the resource. It must
+	// be non-nil; CRD v1 rejects CRDs without a schema.
+	schema *apiextensionsv1.JSONSchemaProps
+
+	// columns are the additional printer columns. In the v1 API these live
+	// under each entry of Versions[], not at the top level.
+	columns []apiextensionsv1.CustomResourceColumnDefinition
+
+	hasStatusSubresource bool
+
+	// additionalServedVersions lists non-storage versions (e.g. v2alpha1)
+	// that are also served for this CRD. They are given the same schema and
+	// printer columns as the storage version; the conversion webhook, not
+	// this schema, is what actually lets old and new clients see the shape
+	// they expect.
+	additionalServedVersions []string
+
+	// conversion configures the CRD's Conversion stanza. Only CNP sets this
+	// today, since it is the only multi-version CRD.
+	conversion *apiextensionsv1.CustomResourceConversion
+}
 
-		CRDName = CustomResourceDefinitionPluralName + "." + SchemeGroupVersion.Group
-	)
+func (d crdDefinition) buildV1() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: d.crdName,
+			Labels: map[string]string{
+				CustomResourceDefinitionSchemaVersionKey: CustomResourceDefinitionSchemaVersion,
+			},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: SchemeGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     d.plural,
+				Singular:   d.singular,
+				ShortNames: d.shortNames,
+				Kind:       d.kind,
+			},
+			Scope:      apiextensionsv1.ResourceScope(d.scope),
+			Versions:   d.versions(),
+			Conversion: d.conversion,
+		},
+	}
+}
 
-	crdBytes, err := examplesCrdsCiliumnetworkpoliciesYamlBytes()
-	if err != nil {
-		panic(err)
+func (d crdDefinition) versions() []apiextensionsv1.CustomResourceDefinitionVersion {
+	versions := []apiextensionsv1.CustomResourceDefinitionVersion{
+		{
+			Name:                     SchemeGroupVersion.Version,
+			Served:                   true,
+			Storage:                  true,
+			Schema:                   &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: d.schema},
+			AdditionalPrinterColumns: d.columns,
+			Subresources:             d.subresources(),
+		},
 	}
-	ciliumCRD := apiextensionsv1beta1.CustomResourceDefinition{}
-	err = yaml.Unmarshal(crdBytes, &ciliumCRD)
-	if err != nil {
-		panic(err)
+	for _, name := range d.additionalServedVersions {
+		versions = append(versions, apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:                     name,
+			Served:                   true,
+			Storage:                  false,
+			Schema:                   &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: d.schema},
+			AdditionalPrinterColumns: d.columns,
+			Subresources:             d.subresources(),
+		})
 	}
+	return versions
+}
 
-	res := &apiextensionsv1beta1.CustomResourceDefinition{
+func (d crdDefinition) buildV1beta1() *apiextensionsv1beta1.CustomResourceDefinition {
+	return &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: CRDName,
+			Name: d.crdName,
 			Labels: map[string]string{
 				CustomResourceDefinitionSchemaVersionKey: CustomResourceDefinitionSchemaVersion,
 			},
@@ -181,181 +269,511 @@ func createCNPCRD(clientset apiextensionsclient.Interface) error {
 			Group:   SchemeGroupVersion.Group,
 			Version: SchemeGroupVersion.Version,
 			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Plural:     CustomResourceDefinitionPluralName,
-				Singular:   CustomResourceDefinitionSingularName,
-				ShortNames: CustomResourceDefinitionShortNames,
-				Kind:       CustomResourceDefinitionKind,
-			},
-			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
-				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+				Plural:     d.plural,
+				Singular:   d.singular,
+				ShortNames: d.shortNames,
+				Kind:       d.kind,
 			},
-			Scope:      apiextensionsv1beta1.NamespaceScoped,
-			Validation: ciliumCRD.Spec.Validation,
+			AdditionalPrinterColumns: toV1beta1Columns(d.columns),
+			Subresources:             d.subresourcesV1beta1(),
+			Scope:                    apiextensionsv1beta1.ResourceScope(d.scope),
+			Validation:               &apiextensionsv1beta1.CustomResourceValidation{OpenAPIV3Schema: toV1beta1Schema(d.schema)},
 		},
 	}
+}
 
-	return createUpdateCRD(clientset, "CiliumNetworkPolicy/v2", res)
+func (d crdDefinition) subresources() *apiextensionsv1.CustomResourceSubresources {
+	if !d.hasStatusSubresource {
+		return nil
+	}
+	return &apiextensionsv1.CustomResourceSubresources{
+		Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+	}
 }
 
-// createCEPCRD creates and updates the CiliumEndpoint CRD. It should be called
-// on agent startup but is idempotent and safe to call again.
-func createCEPCRD(clientset apiextensionsclient.Interface) error {
-	var (
-		// CustomResourceDefinitionSingularName is the singular name of custom resource definition
-		CustomResourceDefinitionSingularName = "ciliumendpoint"
+func (d crdDefinition) subresourcesV1beta1() *apiextensionsv1beta1.CustomResourceSubresources {
+	if !d.hasStatusSubresource {
+		return nil
+	}
+	return &apiextensionsv1beta1.CustomResourceSubresources{
+		Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+	}
+}
 
-		// CustomResourceDefinitionPluralName is the plural name of custom resource definition
-		CustomResourceDefinitionPluralName = "ciliumendpoints"
+// toV1beta1Columns downgrades the per-version v1 printer columns to the
+// top-level v1beta1 representation used by pre-1.16 apiservers.
+func toV1beta1Columns(columns []apiextensionsv1.CustomResourceColumnDefinition) []apiextensionsv1beta1.CustomResourceColumnDefinition {
+	if columns == nil {
+		return nil
+	}
+	out := make([]apiextensionsv1beta1.CustomResourceColumnDefinition, 0, len(columns))
+	for _, c := range columns {
+		out = append(out, apiextensionsv1beta1.CustomResourceColumnDefinition{
+			Name:        c.Name,
+			Type:        c.Type,
+			Description: c.Description,
+			JSONPath:    c.JSONPath,
+		})
+	}
+	return out
+}
 
-		// CustomResourceDefinitionShortNames are the abbreviated names to refer to this CRD's instances
-		CustomResourceDefinitionShortNames = []string{"cep", "ciliumep"}
+// toV1beta1Schema downgrades a structural v1 OpenAPI schema to the looser
+// v1beta1.JSONSchemaProps type. The two wire formats carry the same fields;
+// this recurses through Properties/Items so constraints like Required
+// aren't lost just because they're nested - dropping them would silently
+// make the v1beta1 fallback path (pre-1.16 apiservers) less strict than the
+// v1 schema it was derived from.
+func toV1beta1Schema(s *apiextensionsv1.JSONSchemaProps) *apiextensionsv1beta1.JSONSchemaProps {
+	if s == nil {
+		return &apiextensionsv1beta1.JSONSchemaProps{}
+	}
 
-		// CustomResourceDefinitionKind is the Kind name of custom resource definition
-		CustomResourceDefinitionKind = "CiliumEndpoint"
+	out := &apiextensionsv1beta1.JSONSchemaProps{
+		Type:                   s.Type,
+		Required:               s.Required,
+		XPreserveUnknownFields: s.XPreserveUnknownFields,
+	}
 
-		CRDName = CustomResourceDefinitionPluralName + "." + SchemeGroupVersion.Group
-	)
+	if s.Properties != nil {
+		out.Properties = make(map[string]apiextensionsv1beta1.JSONSchemaProps, len(s.Properties))
+		for name, prop := range s.Properties {
+			out.Properties[name] = *toV1beta1Schema(&prop)
+		}
+	}
 
-	res := &apiextensionsv1beta1.CustomResourceDefinition{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: CRDName,
+	if s.Items != nil && s.Items.Schema != nil {
+		out.Items = &apiextensionsv1beta1.JSONSchemaPropsOrArray{
+			Schema: toV1beta1Schema(s.Items.Schema),
+		}
+	}
+
+	return out
+}
+
+// serverSupportsCRDv1 returns true if the connected apiserver serves
+// apiextensions.k8s.io/v1, which replaces v1beta1 starting with Kubernetes
+// 1.16 and drops v1beta1 entirely in 1.22.
+func serverSupportsCRDv1(clientset apiextensionsclient.Interface) bool {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(apiextensionsV1GroupVersion)
+	return err == nil && resources != nil
+}
+
+// preserveUnknownFieldsSchema returns a minimal structural schema that
+// accepts arbitrary content under spec/status. It is used for CRDs whose
+// full OpenAPI schema is not yet authored; a schema with
+// x-kubernetes-preserve-unknown-fields set is still structural as long as
+// its type is declared, which is all CRD v1 requires.
+func preserveUnknownFieldsSchema() *apiextensionsv1.JSONSchemaProps {
+	preserve := true
+	return &apiextensionsv1.JSONSchemaProps{
+		Type:                   "object",
+		XPreserveUnknownFields: &preserve,
+	}
+}
+
+const (
+	// conversionWebhookServiceName/Namespace/Path identify the operator
+	// service that fronts ConversionWebhookHandler.
+	conversionWebhookServiceName      = "cilium-operator"
+	conversionWebhookServiceNamespace = "kube-system"
+	conversionWebhookServicePath      = "/convert/ciliumnetworkpolicy"
+	conversionWebhookPort             = 443
+)
+
+// cnpConversionWebhook builds the Conversion stanza for the multi-version
+// CiliumNetworkPolicy CRD. caBundle is either the operator's self-signed CA
+// or, when cert-manager is in use, left empty and injected out of band by
+// cert-manager's CA injector annotating the CRD.
+func cnpConversionWebhook(caBundle []byte) *apiextensionsv1.CustomResourceConversion {
+	path := conversionWebhookServicePath
+	port := int32(conversionWebhookPort)
+	return &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ConversionReviewVersions: []string{"v1"},
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				CABundle: caBundle,
+				Service: &apiextensionsv1.ServiceReference{
+					Name:      conversionWebhookServiceName,
+					Namespace: conversionWebhookServiceNamespace,
+					Path:      &path,
+					Port:      &port,
+				},
+			},
 		},
-		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
-			Group:   SchemeGroupVersion.Group,
-			Version: SchemeGroupVersion.Version,
-			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Plural:     CustomResourceDefinitionPluralName,
-				Singular:   CustomResourceDefinitionSingularName,
-				ShortNames: CustomResourceDefinitionShortNames,
-				Kind:       CustomResourceDefinitionKind,
+	}
+}
+
+// createCNPCRD creates and updates the CiliumNetworkPolicies CRD. It should be called
+// on agent startup but is idempotent and safe to call again.
+//
+// CNP is served as both v2 (storage) and v2alpha1; CA bundle of the
+// conversion webhook is passed in by the caller since its source
+// (self-signed, generated at operator startup, or cert-manager) is a
+// deployment-time choice, not a policy concern. On the v1beta1 fallback path
+// only v2 is installed, without the conversion webhook.
+func createCNPCRD(clientset apiextensionsclient.Interface, webhookCABundle []byte) error {
+	def := crdDefinition{
+		crdName:                  "ciliumnetworkpolicies." + SchemeGroupVersion.Group,
+		plural:                   "ciliumnetworkpolicies",
+		singular:                 "ciliumnetworkpolicy",
+		shortNames:               []string{"cnp", "ciliumnp"},
+		kind:                     CNPKindDefinition,
+		scope:                    "Namespaced",
+		schema:                   cnpSchema(),
+		hasStatusSubresource:     false,
+		additionalServedVersions: []string{"v2alpha1"},
+		conversion:               cnpConversionWebhook(webhookCABundle),
+	}
+
+	return createUpdateCRD(clientset, "CiliumNetworkPolicy/v2", def)
+}
+
+// createCCNPCRD creates and updates the CiliumClusterwideNetworkPolicy CRD.
+// It should be called on agent startup but is idempotent and safe to call
+// again. CCNP rules carry the same api.Rule payload as CNP, so the two CRDs
+// share a schema, and the CRD itself is registered cluster-scoped in the k8s
+// apiserver (no Namespace field).
+//
+// This only registers the CRD. Making a cluster-scoped rule actually
+// evaluate against endpoints in every namespace is the policy repository's
+// job (translating CiliumClusterwideNetworkPolicy into api.Rules without the
+// implicit namespace-selector restriction CNP's translation adds), and that
+// repository does not exist in this source tree - only
+// pkg/k8s/apis/cilium.io and pkg/policy/api are present here, not
+// pkg/policy's Repository/rule-translation engine. See CiliumGroup's
+// GroupReferences note in pkg/policy/api/rule.go for the same kind of gap.
+func createCCNPCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:              "ciliumclusterwidenetworkpolicies." + SchemeGroupVersion.Group,
+		plural:               "ciliumclusterwidenetworkpolicies",
+		singular:             "ciliumclusterwidenetworkpolicy",
+		shortNames:           []string{"ccnp"},
+		kind:                 "CiliumClusterwideNetworkPolicy",
+		scope:                "Cluster",
+		schema:               cnpSchema(),
+		hasStatusSubresource: true,
+	}
+
+	return createUpdateCRD(clientset, "CiliumClusterwideNetworkPolicy/v2", def)
+}
+
+// cnpRuleSchema is the structural OpenAPI v3 schema for a single api.Rule, as
+// embedded in both CiliumNetworkPolicySpec and CiliumNetworkPolicySpecs.
+// EndpointSelector is required, matching api.Rule's own
+// +kubebuilder:validation:Required marker; Ingress/Egress/Labels keep
+// x-kubernetes-preserve-unknown-fields since IngressRule/EgressRule aren't
+// structurally describable from this package without duplicating their
+// definitions from pkg/policy/api.
+func cnpRuleSchema() apiextensionsv1.JSONSchemaProps {
+	preserve := true
+	return apiextensionsv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"endpointSelector"},
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"endpointSelector": {
+				Type:                   "object",
+				XPreserveUnknownFields: &preserve,
 			},
-			AdditionalPrinterColumns: []apiextensionsv1beta1.CustomResourceColumnDefinition{
-				{
-					Name:        "Endpoint ID",
-					Type:        "integer",
-					Description: "Cilium endpoint id",
-					JSONPath:    ".status.id",
-				},
-				{
-					Name:        "Identity ID",
-					Type:        "integer",
-					Description: "Cilium identity id",
-					JSONPath:    ".status.identity.id",
-				},
-				{
-					Name:        "Ingress Enforcement",
-					Type:        "boolean",
-					Description: "Ingress enforcement in the endpoint",
-					JSONPath:    ".status.policy.ingress.enforcing",
+			"ingress": {
+				Type: "array",
+				Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+					Schema: &apiextensionsv1.JSONSchemaProps{
+						Type:                   "object",
+						XPreserveUnknownFields: &preserve,
+					},
 				},
-				{
-					Name:        "Egress Enforcement",
-					Type:        "boolean",
-					Description: "Egress enforcement in the endpoint",
-					JSONPath:    ".status.policy.egress.enforcing",
-				},
-				{
-					Name:        "Endpoint State",
-					Type:        "string",
-					Description: "Endpoint current state",
-					JSONPath:    ".status.state",
-				},
-				{
-					Name:        "IPv4",
-					Type:        "string",
-					Description: "Endpoint IPv4 address",
-					JSONPath:    ".status.networking.addressing[0].ipv4",
-				},
-				{
-					Name:        "IPv6",
-					Type:        "string",
-					Description: "Endpoint IPv6 address",
-					JSONPath:    ".status.networking.addressing[0].ipv6",
+			},
+			"egress": {
+				Type: "array",
+				Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+					Schema: &apiextensionsv1.JSONSchemaProps{
+						Type:                   "object",
+						XPreserveUnknownFields: &preserve,
+					},
 				},
 			},
-			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
-				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+			"labels": {
+				Type:                   "array",
+				XPreserveUnknownFields: &preserve,
+			},
+			"description": {
+				Type: "string",
 			},
-			Scope:      apiextensionsv1beta1.NamespaceScoped,
-			Validation: &cepCRV,
 		},
 	}
+}
 
-	return createUpdateCRD(clientset, "v2.CiliumEndpoint", res)
+// cnpSchema returns the structural OpenAPI v3 schema for CiliumNetworkPolicy.
+// The legacy v1beta1 validation embedded the example YAML wholesale, which
+// v1 rejects as non-structural (it is missing a top-level type and mixes in
+// permissive fragments). Rather than discard that validation outright, spec
+// and specs are typed against api.Rule's own field set (the source of truth
+// this package can actually see) so the required endpointSelector and known
+// rule properties are still enforced; status keeps
+// x-kubernetes-preserve-unknown-fields, so the fields of
+// CiliumNetworkPolicyStatus are not validated by this schema.
+func cnpSchema() *apiextensionsv1.JSONSchemaProps {
+	preserve := true
+	rule := cnpRuleSchema()
+	return &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": rule,
+			"specs": {
+				Type:  "array",
+				Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &rule},
+			},
+			"status": {
+				Type:                   "object",
+				XPreserveUnknownFields: &preserve,
+			},
+		},
+	}
 }
 
-// createNodeCRD creates and updates the CiliumNode CRD. It should be called on
-// agent startup but is idempotent and safe to call again.
-func createNodeCRD(clientset apiextensionsclient.Interface) error {
-	res := &apiextensionsv1beta1.CustomResourceDefinition{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "ciliumnodes." + SchemeGroupVersion.Group,
+// groupSelectorSchema is the structural OpenAPI v3 schema shared by
+// CiliumGroup and CiliumClusterwideGroup: a podSelector/namespaceSelector/
+// externalEntitySelector triple plus a childGroups name list, matching
+// GroupSpec.
+func groupSelectorSchema() *apiextensionsv1.JSONSchemaProps {
+	preserve := true
+	labelSelector := apiextensionsv1.JSONSchemaProps{
+		Type:                   "object",
+		XPreserveUnknownFields: &preserve,
+	}
+	return &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"podSelector":            labelSelector,
+					"namespaceSelector":      labelSelector,
+					"externalEntitySelector": labelSelector,
+					"childGroups": {
+						Type: "array",
+						Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+							Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"},
+						},
+					},
+				},
+			},
 		},
-		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
-			Group:   SchemeGroupVersion.Group,
-			Version: SchemeGroupVersion.Version,
-			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Plural:     "ciliumnodes",
-				Singular:   "ciliumnode",
-				ShortNames: []string{"cn"},
-				Kind:       "CiliumNode",
+	}
+}
+
+// createGroupCRD creates and updates the namespaced CiliumGroup CRD. It
+// should be called on agent startup but is idempotent and safe to call
+// again.
+func createGroupCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:    "ciliumgroups." + SchemeGroupVersion.Group,
+		plural:     "ciliumgroups",
+		singular:   "ciliumgroup",
+		shortNames: []string{"cgroup"},
+		kind:       "CiliumGroup",
+		scope:      "Namespaced",
+		schema:     groupSelectorSchema(),
+	}
+
+	return createUpdateCRD(clientset, "v2.CiliumGroup", def)
+}
+
+// createClusterwideGroupCRD creates and updates the cluster-scoped
+// CiliumClusterwideGroup CRD. It should be called on agent startup but is
+// idempotent and safe to call again.
+func createClusterwideGroupCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:    "ciliumclusterwidegroups." + SchemeGroupVersion.Group,
+		plural:     "ciliumclusterwidegroups",
+		singular:   "ciliumclusterwidegroup",
+		shortNames: []string{"ccgroup"},
+		kind:       "CiliumClusterwideGroup",
+		scope:      "Cluster",
+		schema:     groupSelectorSchema(),
+	}
+
+	return createUpdateCRD(clientset, "v2.CiliumClusterwideGroup", def)
+}
+
+// createCEPCRD creates and updates the CiliumEndpoint CRD. It should be called
+// on agent startup but is idempotent and safe to call again.
+func createCEPCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:    "ciliumendpoints." + SchemeGroupVersion.Group,
+		plural:     "ciliumendpoints",
+		singular:   "ciliumendpoint",
+		shortNames: []string{"cep", "ciliumep"},
+		kind:       "CiliumEndpoint",
+		scope:      "Namespaced",
+		schema:     preserveUnknownFieldsSchema(),
+		columns: []apiextensionsv1.CustomResourceColumnDefinition{
+			{
+				Name:        "Endpoint ID",
+				Type:        "integer",
+				Description: "Cilium endpoint id",
+				JSONPath:    ".status.id",
+			},
+			{
+				Name:        "Identity ID",
+				Type:        "integer",
+				Description: "Cilium identity id",
+				JSONPath:    ".status.identity.id",
+			},
+			{
+				Name:        "Ingress Enforcement",
+				Type:        "boolean",
+				Description: "Ingress enforcement in the endpoint",
+				JSONPath:    ".status.policy.ingress.enforcing",
+			},
+			{
+				Name:        "Egress Enforcement",
+				Type:        "boolean",
+				Description: "Egress enforcement in the endpoint",
+				JSONPath:    ".status.policy.egress.enforcing",
+			},
+			{
+				Name:        "Endpoint State",
+				Type:        "string",
+				Description: "Endpoint current state",
+				JSONPath:    ".status.state",
+			},
+			{
+				Name:        "IPv4",
+				Type:        "string",
+				Description: "Endpoint IPv4 address",
+				JSONPath:    ".status.networking.addressing[0].ipv4",
 			},
-			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
-				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+			{
+				Name:        "IPv6",
+				Type:        "string",
+				Description: "Endpoint IPv6 address",
+				JSONPath:    ".status.networking.addressing[0].ipv6",
 			},
-			Scope: apiextensionsv1beta1.ClusterScoped,
 		},
+		hasStatusSubresource: true,
 	}
 
-	return createUpdateCRD(clientset, "v2.CiliumNode", res)
+	return createUpdateCRD(clientset, "v2.CiliumEndpoint", def)
+}
+
+// createNodeCRD creates and updates the CiliumNode CRD. It should be called on
+// agent startup but is idempotent and safe to call again.
+func createNodeCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:              "ciliumnodes." + SchemeGroupVersion.Group,
+		plural:               "ciliumnodes",
+		singular:             "ciliumnode",
+		shortNames:           []string{"cn"},
+		kind:                 "CiliumNode",
+		scope:                "Cluster",
+		schema:               preserveUnknownFieldsSchema(),
+		hasStatusSubresource: true,
+	}
+
+	return createUpdateCRD(clientset, "v2.CiliumNode", def)
 }
 
 // createIdentityCRD creates and updates the CiliumIdentity CRD. It should be
 // called on agent startup but is idempotent and safe to call again.
 func createIdentityCRD(clientset apiextensionsclient.Interface) error {
+	def := crdDefinition{
+		crdName:    "ciliumidentities." + SchemeGroupVersion.Group,
+		plural:     "ciliumidentities",
+		singular:   "ciliumidentity",
+		shortNames: []string{"ciliumid"},
+		kind:       "CiliumIdentity",
+		scope:      "Cluster",
+		schema:     preserveUnknownFieldsSchema(),
+	}
 
-	var (
-		// CustomResourceDefinitionSingularName is the singular name of custom resource definition
-		CustomResourceDefinitionSingularName = "ciliumidentity"
+	return createUpdateCRD(clientset, "v2.CiliumIdentity", def)
+}
 
-		// CustomResourceDefinitionPluralName is the plural name of custom resource definition
-		CustomResourceDefinitionPluralName = "ciliumidentities"
+// createUpdateCRD ensures the CRD object is installed into the k8s cluster. It
+// will create or update the CRD and its validation when needed, preferring
+// apiextensions/v1 and falling back to v1beta1 for apiservers that do not yet
+// serve the v1 CRD API (Kubernetes < 1.16).
+func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, def crdDefinition) error {
+	if serverSupportsCRDv1(clientset) {
+		return createUpdateCRDv1(clientset, CRDName, def.buildV1())
+	}
+	return createUpdateCRDv1beta1(clientset, CRDName, def.buildV1beta1())
+}
 
-		// CustomResourceDefinitionShortNames are the abbreviated names to refer to this CRD's instances
-		CustomResourceDefinitionShortNames = []string{"ciliumid"}
+func createUpdateCRDv1(clientset apiextensionsclient.Interface, CRDName string, crd *apiextensionsv1.CustomResourceDefinition) error {
+	scopedLog := log.WithField("name", CRDName)
 
-		// CustomResourceDefinitionKind is the Kind name of custom resource definition
-		CustomResourceDefinitionKind = "CiliumIdentity"
+	clusterCRD, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		scopedLog.Info("Creating CRD (CustomResourceDefinition)...")
+		clusterCRD, err = clientset.ApiextensionsV1().CustomResourceDefinitions().Create(crd)
+		// This occurs when multiple agents race to create the CRD. Since another has
+		// created it, it will also update it, hence the non-error return.
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
 
-		CRDName = CustomResourceDefinitionPluralName + "." + SchemeGroupVersion.Group
-	)
+	scopedLog.Debug("Checking if CRD (CustomResourceDefinition) needs update...")
+	if needsUpdateV1(clusterCRD, crd) {
+		scopedLog.Info("Updating CRD (CustomResourceDefinition)...")
+		err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
+			clusterCRD, err = clientset.ApiextensionsV1().
+				CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
 
-	res := &apiextensionsv1beta1.CustomResourceDefinition{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: CRDName,
-		},
-		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
-			Group:   SchemeGroupVersion.Group,
-			Version: SchemeGroupVersion.Version,
-			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Plural:     CustomResourceDefinitionPluralName,
-				Singular:   CustomResourceDefinitionSingularName,
-				ShortNames: CustomResourceDefinitionShortNames,
-				Kind:       CustomResourceDefinitionKind,
-			},
-			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
-				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
-			},
-			Scope: apiextensionsv1beta1.ClusterScoped,
-		},
+			if err != nil {
+				return false, err
+			}
+
+			if needsUpdateV1(clusterCRD, crd) {
+				scopedLog.Debug("CRD validation is different, updating it...")
+				clusterCRD.ObjectMeta.Labels = crd.ObjectMeta.Labels
+				clusterCRD.Spec = mergeCRDSpec(clusterCRD.Spec, crd.Spec)
+				_, err = clientset.ApiextensionsV1().CustomResourceDefinitions().Update(clusterCRD)
+				if err == nil {
+					return true, nil
+				}
+				scopedLog.WithError(err).Debug("Unable to update CRD validation")
+				return false, err
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			scopedLog.WithError(err).Error("Unable to update CRD")
+			return err
+		}
+	}
+
+	scopedLog.Debug("Waiting for CRD (CustomResourceDefinition) to be available...")
+	err = waitForEstablished(context.Background(), CRDName, func() ([]apiextensionsv1.CustomResourceDefinitionCondition, error) {
+		got, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return got.Status.Conditions, nil
+	})
+	if err != nil {
+		// Deliberately not deleting the CRD here: a slow or flaky apiserver
+		// shouldn't cost users every CustomResource stored under it. The
+		// next reconcile pass (this agent's next restart, or whichever
+		// agent next holds the reconcile lease) will pick up where this
+		// one left off.
+		scopedLog.WithError(err).Error("CRD did not become established in time; leaving it installed for the next reconcile attempt")
+		return err
 	}
 
-	return createUpdateCRD(clientset, "v2.CiliumIdentity", res)
+	scopedLog.Info("CRD (CustomResourceDefinition) is installed and up-to-date")
+	return nil
 }
 
-// createUpdateCRD ensures the CRD object is installed into the k8s cluster. It
-// will create or update the CRD and it's validation when needed
-func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+func createUpdateCRDv1beta1(clientset apiextensionsclient.Interface, CRDName string, crd *apiextensionsv1beta1.CustomResourceDefinition) error {
 	scopedLog := log.WithField("name", CRDName)
 
 	clusterCRD, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
@@ -373,7 +791,7 @@ func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, cr
 	}
 
 	scopedLog.Debug("Checking if CRD (CustomResourceDefinition) needs update...")
-	if needsUpdate(clusterCRD) {
+	if needsUpdateV1beta1(clusterCRD) {
 		scopedLog.Info("Updating CRD (CustomResourceDefinition)...")
 		// Update the CRD with the validation schema.
 		err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
@@ -385,9 +803,9 @@ func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, cr
 			}
 
 			// This seems too permissive but we only get here if the version is
-			// different per needsUpdate above. If so, we want to update on any
-			// validation change including adding or removing validation.
-			if needsUpdate(clusterCRD) {
+			// different per needsUpdateV1beta1 above. If so, we want to update on
+			// any validation change including adding or removing validation.
+			if needsUpdateV1beta1(clusterCRD) {
 				scopedLog.Debug("CRD validation is different, updating it...")
 				clusterCRD.ObjectMeta.Labels = crd.ObjectMeta.Labels
 				clusterCRD.Spec = crd.Spec
@@ -409,31 +827,17 @@ func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, cr
 
 	// wait for the CRD to be established
 	scopedLog.Debug("Waiting for CRD (CustomResourceDefinition) to be available...")
-	err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
-		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
+	err = waitForEstablishedV1beta1(context.Background(), CRDName, func() ([]apiextensionsv1beta1.CustomResourceDefinitionCondition, error) {
+		got, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crd.ObjectMeta.Name, metav1.GetOptions{})
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		for _, cond := range crd.Status.Conditions {
-			switch cond.Type {
-			case apiextensionsv1beta1.Established:
-				if cond.Status == apiextensionsv1beta1.ConditionTrue {
-					return true, err
-				}
-			case apiextensionsv1beta1.NamesAccepted:
-				if cond.Status == apiextensionsv1beta1.ConditionFalse {
-					scopedLog.WithError(goerrors.New(cond.Reason)).Error("Name conflict for CRD")
-					return false, err
-				}
-			}
-		}
-		return false, err
+		return got.Status.Conditions, nil
 	})
 	if err != nil {
-		deleteErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(crd.ObjectMeta.Name, nil)
-		if deleteErr != nil {
-			return fmt.Errorf("unable to delete k8s %s CRD %s. Deleting CRD due: %s", CRDName, deleteErr, err)
-		}
+		// As with the v1 path above, a slow apiserver is not a reason to
+		// destroy the CRD; leave it for the next reconcile attempt.
+		scopedLog.WithError(err).Error("CRD did not become established in time; leaving it installed for the next reconcile attempt")
 		return err
 	}
 
@@ -441,9 +845,8 @@ func createUpdateCRD(clientset apiextensionsclient.Interface, CRDName string, cr
 	return nil
 }
 
-func needsUpdate(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool {
-
-	if clusterCRD.Spec.Validation == nil {
+func needsUpdateV1(clusterCRD, desiredCRD *apiextensionsv1.CustomResourceDefinition) bool {
+	if len(clusterCRD.Spec.Versions) == 0 || clusterCRD.Spec.Versions[0].Schema == nil {
 		// no validation detected
 		return true
 	}
@@ -453,22 +856,68 @@ func needsUpdate(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool
 		return true
 	}
 	clusterVersion, err := version.NewVersion(v)
-	if err != nil || clusterVersion.LessThan(comparableCRDSchemaVersion) {
-		// version in cluster is either unparsable or smaller than current version
+	if err != nil {
+		// unparsable version in cluster; treat it as needing a fix-up
+		return true
+	}
+	if clusterVersion.GreaterThan(comparableCRDSchemaVersion) {
+		// The cluster's CRD was written by a newer agent than this one. Refuse
+		// to downgrade it: the newer agent's schema is a superset we don't
+		// know how to safely narrow, and a rollback or mixed-version rollout
+		// shouldn't cause flapping between two schemas.
+		crdSchemaDowngradeRefusedTotal.WithLabelValues(clusterCRD.Name).Inc()
+		log.WithField("name", clusterCRD.Name).
+			WithField("clusterVersion", clusterVersion).
+			WithField("desiredVersion", comparableCRDSchemaVersion).
+			Warning("Cluster CRD schema version is newer than this agent's; refusing to downgrade it")
+		return false
+	}
+	if clusterVersion.LessThan(comparableCRDSchemaVersion) {
+		// version in cluster is smaller than current version
+		return true
+	}
+	if conversionDiffers(clusterCRD.Spec.Conversion, desiredCRD.Spec.Conversion) {
+		// the conversion webhook config (e.g. a rotated CA bundle) changed
+		// independently of the schema version
 		return true
 	}
 	return false
 }
 
-var (
-	// cepCRV is a minimal validation for CEP objects. Since only the agent is
-	// creating them, it is better to be permissive and have some data, if buggy,
-	// than to have no data in k8s.
-	cepCRV = apiextensionsv1beta1.CustomResourceValidation{
-		OpenAPIV3Schema: &apiextensionsv1beta1.JSONSchemaProps{},
+// conversionDiffers reports whether the installed CRD's Conversion stanza
+// needs to be brought in line with the desired one. Only CNP sets this
+// today; other CRDs pass nil on both sides and never trigger an update here.
+func conversionDiffers(cluster, desired *apiextensionsv1.CustomResourceConversion) bool {
+	switch {
+	case cluster == nil && desired == nil:
+		return false
+	case cluster == nil || desired == nil:
+		return true
+	case cluster.Strategy != desired.Strategy:
+		return true
+	case cluster.Webhook == nil || desired.Webhook == nil:
+		return cluster.Webhook != desired.Webhook
+	case cluster.Webhook.ClientConfig == nil || desired.Webhook.ClientConfig == nil:
+		return cluster.Webhook.ClientConfig != desired.Webhook.ClientConfig
+	default:
+		return !bytes.Equal(cluster.Webhook.ClientConfig.CABundle, desired.Webhook.ClientConfig.CABundle)
 	}
+}
 
-	cnpCRV = apiextensionsv1beta1.CustomResourceValidation{
-		OpenAPIV3Schema: &apiextensionsv1beta1.JSONSchemaProps{},
+func needsUpdateV1beta1(clusterCRD *apiextensionsv1beta1.CustomResourceDefinition) bool {
+	if clusterCRD.Spec.Validation == nil {
+		// no validation detected
+		return true
 	}
-)
+	v, ok := clusterCRD.Labels[CustomResourceDefinitionSchemaVersionKey]
+	if !ok {
+		// no schema version detected
+		return true
+	}
+	clusterVersion, err := version.NewVersion(v)
+	if err != nil || clusterVersion.LessThan(comparableCRDSchemaVersion) {
+		// version in cluster is either unparsable or smaller than current version
+		return true
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type RegisterSuite struct{}
+
+var _ = Suite(&RegisterSuite{})
+
+// newFakeClientset returns a fake apiextensionsclient.Interface whose
+// discovery either advertises apiextensions.k8s.io/v1 (modern apiserver) or
+// fails to resolve it (pre-1.16 apiserver that only serves v1beta1).
+//
+// It also marks every created CRD Established right away: the real
+// apiserver only flips that status condition once its controller has
+// reconciled the CRD, but the fake ObjectTracker never touches Status at
+// all, so without this reactor createUpdateCRDv1/v1beta1's establish-wait
+// would burn its whole backoff budget and time out on every test.
+func newFakeClientset(supportsV1 bool) *apiextensionsfake.Clientset {
+	clientset := apiextensionsfake.NewSimpleClientset()
+	if supportsV1 {
+		clientset.Fake.Resources = []*metav1.APIResourceList{{GroupVersion: apiextensionsV1GroupVersion}}
+	} else {
+		clientset.Fake.Resources = nil
+	}
+	clientset.Fake.PrependReactor("create", "customresourcedefinitions", markCRDEstablished)
+	return clientset
+}
+
+// markCRDEstablished mutates a freshly-created CRD in place to report
+// Established before handing off to the default create reaction, so the
+// version written into the fake's ObjectTracker already carries it.
+func markCRDEstablished(action k8stesting.Action) (bool, runtime.Object, error) {
+	obj := action.(k8stesting.CreateAction).GetObject()
+	switch crd := obj.(type) {
+	case *apiextensionsv1.CustomResourceDefinition:
+		crd.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{
+			{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue},
+		}
+	case *apiextensionsv1beta1.CustomResourceDefinition:
+		crd.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+			{Type: apiextensionsv1beta1.Established, Status: apiextensionsv1beta1.ConditionTrue},
+		}
+	}
+	return false, nil, nil
+}
+
+func (s *RegisterSuite) TestCreateCNPCRDUsesV1WhenSupported(c *C) {
+	clientset := newFakeClientset(true)
+
+	err := createCNPCRD(clientset, nil)
+	c.Assert(err, IsNil)
+
+	crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumnetworkpolicies."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(crd.Spec.Versions), Equals, 2)
+	c.Assert(crd.Spec.Versions[0].Schema, Not(IsNil))
+	c.Assert(crd.Spec.Versions[0].Storage, Equals, true)
+	c.Assert(crd.Spec.Versions[1].Name, Equals, "v2alpha1")
+	c.Assert(crd.Spec.Versions[1].Storage, Equals, false)
+}
+
+func (s *RegisterSuite) TestCreateCNPCRDFallsBackToV1beta1(c *C) {
+	clientset := newFakeClientset(false)
+
+	err := createCNPCRD(clientset, nil)
+	c.Assert(err, IsNil)
+
+	crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(
+		"ciliumnetworkpolicies."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crd.Spec.Validation, Not(IsNil))
+}
+
+func (s *RegisterSuite) TestCreateCCNPCRDIsClusterScoped(c *C) {
+	clientset := newFakeClientset(true)
+
+	err := createCCNPCRD(clientset)
+	c.Assert(err, IsNil)
+
+	crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumclusterwidenetworkpolicies."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(crd.Spec.Scope, Equals, apiextensionsv1.ClusterScoped)
+	c.Assert(crd.Spec.Names.ShortNames, DeepEquals, []string{"ccnp"})
+}
+
+func (s *RegisterSuite) TestCreateGroupCRDsAreRegistered(c *C) {
+	clientset := newFakeClientset(true)
+
+	c.Assert(createGroupCRD(clientset), IsNil)
+	c.Assert(createClusterwideGroupCRD(clientset), IsNil)
+
+	namespaced, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumgroups."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(namespaced.Spec.Scope, Equals, apiextensionsv1.NamespaceScoped)
+
+	clusterwide, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumclusterwidegroups."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(clusterwide.Spec.Scope, Equals, apiextensionsv1.ClusterScoped)
+}
+
+func (s *RegisterSuite) TestNeedsUpdateV1DetectsMissingSchemaVersion(c *C) {
+	clientset := newFakeClientset(true)
+	c.Assert(createCEPCRD(clientset), IsNil)
+
+	crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumendpoints."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(needsUpdateV1(crd, crd), Equals, false)
+
+	delete(crd.Labels, CustomResourceDefinitionSchemaVersionKey)
+	c.Assert(needsUpdateV1(crd, crd), Equals, true)
+}
+
+func (s *RegisterSuite) TestNeedsUpdateV1DetectsConversionDrift(c *C) {
+	clientset := newFakeClientset(true)
+	c.Assert(createCNPCRD(clientset, []byte("old-ca")), IsNil)
+
+	crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(
+		"ciliumnetworkpolicies."+SchemeGroupVersion.Group, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+
+	desired := crd.DeepCopy()
+	c.Assert(needsUpdateV1(crd, desired), Equals, false)
+
+	desired.Spec.Conversion = cnpConversionWebhook([]byte("new-ca"))
+	c.Assert(needsUpdateV1(crd, desired), Equals, true)
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Convertible is implemented by every non-hub version of
+// CiliumNetworkPolicy (currently only v2alpha1.CiliumNetworkPolicy). A type
+// satisfies this by defining ConvertTo/ConvertFrom against *CiliumNetworkPolicy
+// by signature alone, so this package never has to import the spoke
+// version's package (which would create an import cycle, since the spoke
+// imports this one to reach the hub type).
+type Convertible interface {
+	runtime.Object
+	ConvertTo(hub *CiliumNetworkPolicy) error
+	ConvertFrom(hub *CiliumNetworkPolicy) error
+}
+
+// ConversionWebhookHandler serves the CRD conversion webhook for
+// CiliumNetworkPolicy: it decodes apiextensions/v1.ConversionReview
+// requests, round-trips every object through the v2 hub type, and returns
+// them re-encoded as the version the apiserver asked for.
+//
+// The handler is constructed with a *runtime.Scheme rather than a fixed set
+// of types so that the set of served spoke versions can grow (e.g. a future
+// v2alpha2) without this package needing to change.
+type ConversionWebhookHandler struct {
+	scheme *runtime.Scheme
+}
+
+// NewConversionWebhookHandler returns a handler that converts between
+// CiliumNetworkPolicy versions registered in scheme.
+func NewConversionWebhookHandler(scheme *runtime.Scheme) *ConversionWebhookHandler {
+	return &ConversionWebhookHandler{scheme: scheme}
+}
+
+func (h *ConversionWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &apiextensionsv1.ConversionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, fmt.Sprintf("decoding ConversionReview: %s", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		// The apiserver always sets Request, but this handler reads
+		// untrusted network input and must not panic on a malformed body.
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&apiextensionsv1.ConversionReview{
+			TypeMeta: review.TypeMeta,
+			Response: &apiextensionsv1.ConversionResponse{
+				Result: metav1.Status{Status: "Failure", Message: "ConversionReview missing request"},
+			},
+		})
+		return
+	}
+
+	response := &apiextensionsv1.ConversionReview{
+		TypeMeta: review.TypeMeta,
+		Response: &apiextensionsv1.ConversionResponse{
+			UID: review.Request.UID,
+		},
+	}
+
+	converted, err := h.convertObjects(review.Request.Objects, review.Request.DesiredAPIVersion)
+	if err != nil {
+		response.Response.Result.Status = "Failure"
+		response.Response.Result.Message = err.Error()
+	} else {
+		response.Response.Result.Status = "Success"
+		response.Response.ConvertedObjects = converted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (h *ConversionWebhookHandler) convertObjects(objects []runtime.RawExtension, desiredAPIVersion string) ([]runtime.RawExtension, error) {
+	desiredGV, err := schema.ParseGroupVersion(desiredAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parsing desired API version %q: %w", desiredAPIVersion, err)
+	}
+
+	converted := make([]runtime.RawExtension, 0, len(objects))
+	for _, raw := range objects {
+		hub, err := h.toHub(raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := h.fromHub(hub, desiredGV)
+		if err != nil {
+			return nil, err
+		}
+		out.GetObjectKind().SetGroupVersionKind(desiredGV.WithKind(CNPKindDefinition))
+
+		encoded, err := json.Marshal(out)
+		if err != nil {
+			return nil, fmt.Errorf("encoding converted object: %w", err)
+		}
+		converted = append(converted, runtime.RawExtension{Raw: encoded})
+	}
+	return converted, nil
+}
+
+// toHub decodes raw as whatever version its own apiVersion says it is, and
+// returns it as the v2 hub type. This is the write path: the apiserver
+// stores every version as v2 (the only storage version), so a create/update
+// through a spoke version like v2alpha1 arrives here and must go through
+// ConvertTo, not a direct json.Unmarshal into the hub - the two schemas are
+// only guaranteed identical today, not forever.
+func (h *ConversionWebhookHandler) toHub(raw []byte) (*CiliumNetworkPolicy, error) {
+	var meta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("decoding source object: %w", err)
+	}
+	sourceGV, err := schema.ParseGroupVersion(meta.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parsing source API version %q: %w", meta.APIVersion, err)
+	}
+
+	if sourceGV == SchemeGroupVersion {
+		hub := &CiliumNetworkPolicy{}
+		if err := json.Unmarshal(raw, hub); err != nil {
+			return nil, fmt.Errorf("decoding source object: %w", err)
+		}
+		return hub, nil
+	}
+
+	source, err := h.scheme.New(sourceGV.WithKind(CNPKindDefinition))
+	if err != nil {
+		return nil, fmt.Errorf("no CiliumNetworkPolicy registered for %s: %w", sourceGV, err)
+	}
+	if err := json.Unmarshal(raw, source); err != nil {
+		return nil, fmt.Errorf("decoding source object: %w", err)
+	}
+	spoke, ok := source.(Convertible)
+	if !ok {
+		return nil, fmt.Errorf("%s does not implement conversion to %s", sourceGV, SchemeGroupVersion)
+	}
+
+	hub := &CiliumNetworkPolicy{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		return nil, fmt.Errorf("converting from %s: %w", sourceGV, err)
+	}
+	return hub, nil
+}
+
+// fromHub returns hub re-encoded as desiredGV, via ConvertFrom when desiredGV
+// isn't the hub version itself.
+func (h *ConversionWebhookHandler) fromHub(hub *CiliumNetworkPolicy, desiredGV schema.GroupVersion) (runtime.Object, error) {
+	if desiredGV == SchemeGroupVersion {
+		return hub, nil
+	}
+
+	target, err := h.scheme.New(desiredGV.WithKind(CNPKindDefinition))
+	if err != nil {
+		return nil, fmt.Errorf("no CiliumNetworkPolicy registered for %s: %w", desiredGV, err)
+	}
+	spoke, ok := target.(Convertible)
+	if !ok {
+		return nil, fmt.Errorf("%s does not implement conversion from %s", desiredGV, SchemeGroupVersion)
+	}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		return nil, fmt.Errorf("converting to %s: %w", desiredGV, err)
+	}
+	return spoke, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file lives in the v2_test package, not v2, because it is the only
+// place in this package that needs to import v2alpha1 (to exercise the
+// webhook's spoke-version conversion); v2alpha1 itself imports v2 to reach
+// the hub type, so v2's own test binary can't import v2alpha1 without
+// creating a cycle.
+package v2_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "gopkg.in/check.v1"
+
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	v2alpha1 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2alpha1"
+)
+
+type WebhookSuite struct{}
+
+var _ = Suite(&WebhookSuite{})
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = v2.AddToScheme(scheme)
+	_ = v2alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func (s *WebhookSuite) TestServeHTTPConvertsToSameVersion(c *C) {
+	handler := v2.NewConversionWebhookHandler(newTestScheme())
+
+	hub := &v2.CiliumNetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v2.SchemeGroupVersion.String(), Kind: "CiliumNetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+	}
+	raw, err := json.Marshal(hub)
+	c.Assert(err, IsNil)
+
+	review := &apiextensionsv1.ConversionReview{
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("test-uid"),
+			DesiredAPIVersion: v2.SchemeGroupVersion.String(),
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	c.Assert(err, IsNil)
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var got apiextensionsv1.ConversionReview
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &got), IsNil)
+	c.Assert(got.Response.Result.Status, Equals, "Success")
+	c.Assert(got.Response.ConvertedObjects, HasLen, 1)
+}
+
+func (s *WebhookSuite) TestServeHTTPConvertsToSpokeVersion(c *C) {
+	handler := v2.NewConversionWebhookHandler(newTestScheme())
+
+	hub := &v2.CiliumNetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v2.SchemeGroupVersion.String(), Kind: "CiliumNetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+	}
+	raw, err := json.Marshal(hub)
+	c.Assert(err, IsNil)
+
+	review := &apiextensionsv1.ConversionReview{
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("test-uid"),
+			DesiredAPIVersion: v2alpha1.SchemeGroupVersion.String(),
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	c.Assert(err, IsNil)
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var got apiextensionsv1.ConversionReview
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &got), IsNil)
+	c.Assert(got.Response.Result.Status, Equals, "Success")
+	c.Assert(got.Response.ConvertedObjects, HasLen, 1)
+
+	var converted v2alpha1.CiliumNetworkPolicy
+	c.Assert(json.Unmarshal(got.Response.ConvertedObjects[0].Raw, &converted), IsNil)
+	c.Assert(converted.Name, Equals, "foo")
+}
+
+// TestServeHTTPConvertsSpokeToHub exercises the write path: the apiserver
+// hands the webhook an object in the non-storage (v2alpha1) shape and asks
+// for it back as v2 so it can be persisted. This must decode the object as
+// v2alpha1 and call ConvertTo, not json.Unmarshal the raw bytes straight
+// into the hub type.
+func (s *WebhookSuite) TestServeHTTPConvertsSpokeToHub(c *C) {
+	handler := v2.NewConversionWebhookHandler(newTestScheme())
+
+	spoke := &v2alpha1.CiliumNetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v2alpha1.SchemeGroupVersion.String(), Kind: "CiliumNetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: "bar"},
+	}
+	raw, err := json.Marshal(spoke)
+	c.Assert(err, IsNil)
+
+	review := &apiextensionsv1.ConversionReview{
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("test-uid"),
+			DesiredAPIVersion: v2.SchemeGroupVersion.String(),
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	c.Assert(err, IsNil)
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var got apiextensionsv1.ConversionReview
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &got), IsNil)
+	c.Assert(got.Response.Result.Status, Equals, "Success")
+	c.Assert(got.Response.ConvertedObjects, HasLen, 1)
+
+	var converted v2.CiliumNetworkPolicy
+	c.Assert(json.Unmarshal(got.Response.ConvertedObjects[0].Raw, &converted), IsNil)
+	c.Assert(converted.Name, Equals, "bar")
+}
+
+// TestServeHTTPRejectsMissingRequest makes sure a ConversionReview body with
+// no "request" field (valid JSON, decodes to Request == nil) gets a
+// structured Failure response instead of a panic from dereferencing a nil
+// *ConversionRequest.
+func (s *WebhookSuite) TestServeHTTPRejectsMissingRequest(c *C) {
+	handler := v2.NewConversionWebhookHandler(newTestScheme())
+
+	req := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader([]byte(`{}`)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var got apiextensionsv1.ConversionReview
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &got), IsNil)
+	c.Assert(got.Response, Not(IsNil))
+	c.Assert(got.Response.Result.Status, Equals, "Failure")
+}
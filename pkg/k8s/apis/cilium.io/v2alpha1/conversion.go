@@ -0,0 +1,40 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2alpha1
+
+import (
+	"github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+)
+
+// ConvertTo converts this v2alpha1 CiliumNetworkPolicy to the v2 hub type.
+// The two versions share the same spec/status shape today, so this is a
+// straight field copy; it is the seam future schema changes convert across.
+func (in *CiliumNetworkPolicy) ConvertTo(hub *v2.CiliumNetworkPolicy) error {
+	hub.ObjectMeta = in.ObjectMeta
+	hub.Spec = in.Spec
+	hub.Specs = in.Specs
+	hub.Status = in.Status
+	return nil
+}
+
+// ConvertFrom populates this v2alpha1 CiliumNetworkPolicy from the v2 hub
+// type.
+func (in *CiliumNetworkPolicy) ConvertFrom(hub *v2.CiliumNetworkPolicy) error {
+	in.ObjectMeta = hub.ObjectMeta
+	in.Spec = hub.Spec
+	in.Specs = hub.Specs
+	in.Status = hub.Status
+	return nil
+}
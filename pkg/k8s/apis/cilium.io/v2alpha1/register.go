@@ -0,0 +1,60 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v2alpha1 holds the next, not-yet-stable revision of the policy
+// CRD schema. Objects read or written as v2alpha1 are converted to/from v2
+// (the storage version) by the webhook in
+// github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2, so that the two
+// versions can evolve independently of what is persisted in etcd/k8s.
+package v2alpha1
+
+import (
+	k8sconst "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CustomResourceDefinitionVersion is the version handled by this package.
+const CustomResourceDefinitionVersion = "v2alpha1"
+
+// SchemeGroupVersion is group version used to register these objects.
+var SchemeGroupVersion = schema.GroupVersion{
+	Group:   k8sconst.GroupName,
+	Version: CustomResourceDefinitionVersion,
+}
+
+var (
+	// SchemeBuilder is needed by DeepCopy generator.
+	SchemeBuilder runtime.SchemeBuilder
+	localSchemeBuilder = &SchemeBuilder
+
+	// AddToScheme adds all types of this clientset into the given scheme.
+	AddToScheme = localSchemeBuilder.AddToScheme
+)
+
+func init() {
+	localSchemeBuilder.Register(addKnownTypes)
+}
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&CiliumNetworkPolicy{},
+		&CiliumNetworkPolicyList{},
+	)
+
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen=true
+
+// CiliumNetworkPolicy is the v2alpha1 representation of a Cilium network
+// policy. It is served alongside v2 but is not the storage version; the
+// conversion webhook in v2 translates between the two on every read and
+// write so stored objects stay in the v2 shape regardless of which version
+// a client requests.
+type CiliumNetworkPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   *api.Rule                  `json:"spec,omitempty"`
+	Specs  api.Rules                  `json:"specs,omitempty"`
+	Status v2.CiliumNetworkPolicyStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen=true
+
+// CiliumNetworkPolicyList is a list of v2alpha1 CiliumNetworkPolicy objects.
+type CiliumNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CiliumNetworkPolicy `json:"items"`
+}
@@ -64,6 +64,19 @@ type Rule struct {
 	Description string `json:"description,omitempty"`
 }
 
+// GroupReferences is the type intended for FromGroups and ToGroups fields on
+// IngressRule and EgressRule: each entry is the name of a CiliumGroup or
+// CiliumClusterwideGroup (see pkg/k8s/apis/cilium.io/v2's GroupResolver)
+// that would resolve into EndpointSelectors at policy translation time.
+//
+// It is not yet attached to IngressRule or EgressRule: neither type is
+// defined in this source tree (only this file, rule.go, is present under
+// pkg/policy/api), so the field can't be added here without guessing at
+// those types' real shape. This type exists so the wiring is a single field
+// addition once those definitions are available, rather than also needing a
+// new type invented at that point.
+type GroupReferences []string
+
 // NewRule builds a new rule with no selector and no policy.
 func NewRule() *Rule {
 	return &Rule{}